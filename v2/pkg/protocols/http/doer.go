@@ -0,0 +1,258 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+
+	"github.com/projectdiscovery/nuclei/v2/pkg/protocols/common/generators"
+	"github.com/projectdiscovery/rawhttp"
+)
+
+// HTTPDoer abstracts the transport dump() and the request executor use to
+// send a generatedRequest and produce its wire-format dump, so alternative
+// transports (fasthttp, CycleTLS-style JA3 clients, etc.) can be plugged in
+// without forking the request executor. Selected per-template via the
+// `client:` field.
+type HTTPDoer interface {
+	Do(req *generatedRequest) (*http.Response, error)
+	DumpRequest(req *generatedRequest, reqURL string) ([]byte, error)
+	DumpResponse(resp *http.Response) ([]byte, error)
+}
+
+// DoerOptions carries whatever configuration a pluggable doer needs, eg. the
+// TLS fingerprint to impersonate or a preconfigured client.
+type DoerOptions struct {
+	Client      *http.Client
+	Fingerprint string
+	// UnsafeProtocol selects h2/h3 frame-level framing for rawhttpDoer,
+	// populated from the raw request's `unsafe-http2` / `unsafe-http3`
+	// switches. Ignored by stdlibDoer.
+	UnsafeProtocol UnsafeProtocol
+}
+
+// DoerFactory builds an HTTPDoer from DoerOptions; registered via
+// RegisterDoer and selected per-template through the `client:` field.
+type DoerFactory func(options DoerOptions) HTTPDoer
+
+var (
+	doerRegistryMu sync.RWMutex
+	doerRegistry   = map[string]DoerFactory{
+		"stdlib":  func(opts DoerOptions) HTTPDoer { return newStdlibDoer(opts) },
+		"rawhttp": func(opts DoerOptions) HTTPDoer { return newRawhttpDoer(opts) },
+	}
+)
+
+// RegisterDoer makes a named HTTPDoer implementation available for templates
+// to select via their `client:` field, alongside the builtin "stdlib" and
+// "rawhttp" doers.
+func RegisterDoer(name string, factory DoerFactory) {
+	doerRegistryMu.Lock()
+	defer doerRegistryMu.Unlock()
+	doerRegistry[name] = factory
+}
+
+// doerByName resolves a registered DoerFactory, defaulting to "stdlib" when
+// name is empty.
+func doerByName(name string, options DoerOptions) (HTTPDoer, error) {
+	if name == "" {
+		name = "stdlib"
+	}
+	doerRegistryMu.RLock()
+	factory, ok := doerRegistry[name]
+	doerRegistryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no HTTPDoer registered for client %q", name)
+	}
+	return factory(options), nil
+}
+
+// decodedByDoerContextKey marks a request's response as already decoded by
+// the doer that sent it, so handleDecompression can skip re-decoding a body
+// a non-stdlib doer (eg. fasthttp) already decompressed itself.
+type decodedByDoerContextKey struct{}
+
+func markDecodedByDoer(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), decodedByDoerContextKey{}, true))
+}
+
+func alreadyDecodedByDoer(resp *http.Response) bool {
+	if resp == nil || resp.Request == nil {
+		return false
+	}
+	decoded, _ := resp.Request.Context().Value(decodedByDoerContextKey{}).(bool)
+	return decoded
+}
+
+// clientNameContextKey carries the template `client:` selection onto the
+// outgoing *http.Request, so code that only has the resulting *http.Response
+// (eg. the redirect-chain dumper, which is handed individual hops long after
+// dump()'s caller picked a client) can still resolve the same HTTPDoer that
+// sent it.
+type clientNameContextKey struct{}
+
+// WithClientName attaches the template's `client:` selection to req, so it
+// can be recovered later from a response via clientNameFromResponse.
+func WithClientName(req *http.Request, name string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), clientNameContextKey{}, name))
+}
+
+// clientNameFromRequest recovers a `client:` selection previously attached
+// with WithClientName, defaulting to "" when req carries none.
+func clientNameFromRequest(req *http.Request) string {
+	if req == nil {
+		return ""
+	}
+	name, _ := req.Context().Value(clientNameContextKey{}).(string)
+	return name
+}
+
+// clientNameFromResponse recovers a `client:` selection previously attached
+// with WithClientName, defaulting to "" (dump()'s own "stdlib"/"rawhttp"
+// fallback) when resp or its originating request carries none.
+func clientNameFromResponse(resp *http.Response) string {
+	if resp == nil {
+		return ""
+	}
+	return clientNameFromRequest(resp.Request)
+}
+
+// doerOptionsFromResponse rebuilds the DoerOptions a response's originating
+// request was sent with, so the redirect-chain dumper dumps each hop through
+// the same doer/fingerprint dump() used to send it, instead of always
+// falling back to a bare httputil.DumpResponse. Only Fingerprint is
+// recovered; Client and UnsafeProtocol are left at their zero values.
+func doerOptionsFromResponse(resp *http.Response) DoerOptions {
+	if resp == nil || resp.Request == nil {
+		return DoerOptions{}
+	}
+	return DoerOptions{Fingerprint: fingerprintFromRequest(resp.Request)}
+}
+
+// stdlibDoer is the default HTTPDoer, backed by net/http - dump()'s original
+// req.request branch.
+type stdlibDoer struct {
+	client *http.Client
+}
+
+func newStdlibDoer(opts DoerOptions) *stdlibDoer {
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if opts.Fingerprint != "" {
+		client = withFingerprintClient(client, opts.Fingerprint)
+	}
+	return &stdlibDoer{client: client}
+}
+
+// withFingerprintClient returns a shallow copy of client with its transport
+// wrapped in a FingerprintTransport impersonating fingerprint, preserving
+// whatever dialer/proxy settings the client's existing *http.Transport (if
+// any) already carried.
+func withFingerprintClient(client *http.Client, fingerprint string) *http.Client {
+	base, _ := client.Transport.(*http.Transport)
+	if base == nil {
+		base = http.DefaultTransport.(*http.Transport).Clone()
+	} else {
+		base = base.Clone()
+	}
+	transport, err := NewFingerprintTransport(fingerprint, base)
+	if err != nil {
+		// fall back to the unmodified client rather than failing the request
+		// outright - an invalid -tls-fingerprint value shouldn't break
+		// requests that don't care about the spoofed ClientHello.
+		return client
+	}
+	cloned := *client
+	cloned.Transport = transport
+	return &cloned
+}
+
+func (d *stdlibDoer) Do(req *generatedRequest) (*http.Response, error) {
+	if req.request == nil {
+		return nil, errors.New("stdlibDoer: request has no standard net/http request to send")
+	}
+	bodyBytes, _ := req.request.BodyBytes()
+	req.request.Request.Body = ioutil.NopCloser(bytes.NewReader(bodyBytes))
+	req.request.Request = WithRemoteAddrTrace(req.request.Request)
+	return d.client.Do(req.request.Request)
+}
+
+func (d *stdlibDoer) DumpRequest(req *generatedRequest, reqURL string) ([]byte, error) {
+	if req.request == nil {
+		return nil, errors.New("stdlibDoer: request has no standard net/http request to dump")
+	}
+	// Create a copy on the fly of the request body - ignore errors
+	bodyBytes, _ := req.request.BodyBytes()
+	req.request.Request.Body = ioutil.NopCloser(bytes.NewReader(bodyBytes))
+	return httputil.DumpRequestOut(req.request.Request, true)
+}
+
+// DumpResponse dumps resp the same way net/http/httputil always has for this
+// doer; kept as its own method (rather than the redirect-chain dumper calling
+// httputil.DumpResponse directly) so a doer backed by a different transport
+// can render its own response dump format.
+func (d *stdlibDoer) DumpResponse(resp *http.Response) ([]byte, error) {
+	return httputil.DumpResponse(resp, false)
+}
+
+// rawhttpDoer is the default HTTPDoer for unsafe requests, backed by
+// rawhttp - dump()'s original req.rawRequest branch. protocol selects h2/h3
+// frame-level framing (see h2h3.go) instead of rawhttp's HTTP/1.x framing
+// when the raw request carries `unsafe-http2`/`unsafe-http3`.
+type rawhttpDoer struct {
+	protocol UnsafeProtocol
+}
+
+func newRawhttpDoer(opts DoerOptions) *rawhttpDoer {
+	return &rawhttpDoer{protocol: opts.UnsafeProtocol}
+}
+
+func (d *rawhttpDoer) Do(req *generatedRequest) (*http.Response, error) {
+	if req.rawRequest == nil {
+		return nil, errors.New("rawhttpDoer: request has no raw request to send")
+	}
+	if d.protocol != UnsafeProtocolHTTP1 {
+		rawURL := framedRawURL(req.rawRequest.FullURL, req.rawRequest.Headers, req.rawRequest.Path)
+		return sendFramedRequest(d.protocol, rawURL, req.rawRequest.Method, req.rawRequest.Path, req.rawRequest.Headers, req.rawRequest.Data)
+	}
+	client := rawhttp.NewClient(rawhttp.DefaultOptions)
+	return client.DoRaw(req.rawRequest.Method, req.rawRequest.FullURL, req.rawRequest.Path, generators.ExpandMapValues(req.rawRequest.Headers), ioutil.NopCloser(strings.NewReader(req.rawRequest.Data)))
+}
+
+// framedRawURL resolves the absolute URL sendFramedRequest dials for the
+// h2/h3 framed path, preferring the raw request's already-resolved FullURL
+// (set by raw.Parse for templated requests) and only reconstructing one from
+// its Host header and path for fully unsafe/self-contained requests that
+// never had a FullURL assigned.
+func framedRawURL(fullURL string, headers map[string]string, path string) string {
+	if fullURL != "" {
+		return fullURL
+	}
+	return "https://" + headers["Host"] + path
+}
+
+func (d *rawhttpDoer) DumpRequest(req *generatedRequest, reqURL string) ([]byte, error) {
+	if req.rawRequest == nil {
+		return nil, errors.New("rawhttpDoer: request has no raw request to dump")
+	}
+	if d.protocol != UnsafeProtocolHTTP1 {
+		return dumpFramedRequest(d.protocol, req.rawRequest.Method, req.rawRequest.Headers["Host"], req.rawRequest.Path, req.rawRequest.Headers, req.rawRequest.Data)
+	}
+	return rawhttp.DumpRequestRaw(req.rawRequest.Method, reqURL, req.rawRequest.Path, generators.ExpandMapValues(req.rawRequest.Headers), ioutil.NopCloser(strings.NewReader(req.rawRequest.Data)), rawhttp.Options{CustomHeaders: req.rawRequest.UnsafeHeaders})
+}
+
+// DumpResponse dumps resp the same way net/http/httputil always has -
+// rawhttpDoer.Do hands back a standard *http.Response whether the request
+// went out HTTP/1.x (via rawhttp's DoRaw) or as raw h2 frames (via
+// sendFramedRequest), so there's no rawhttp-specific dump format to produce here.
+func (d *rawhttpDoer) DumpResponse(resp *http.Response) ([]byte, error) {
+	return httputil.DumpResponse(resp, false)
+}
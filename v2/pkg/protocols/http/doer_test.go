@@ -0,0 +1,131 @@
+package http
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type noopDoer struct{}
+
+func (noopDoer) Do(_ *generatedRequest) (*http.Response, error) { return nil, nil }
+func (noopDoer) DumpRequest(_ *generatedRequest, _ string) ([]byte, error) {
+	return []byte("noop"), nil
+}
+func (noopDoer) DumpResponse(_ *http.Response) ([]byte, error) {
+	return []byte("noop"), nil
+}
+
+func TestDoerByNameBuiltins(t *testing.T) {
+	stdlib, err := doerByName("stdlib", DoerOptions{})
+	require.NoError(t, err)
+	require.IsType(t, &stdlibDoer{}, stdlib)
+
+	rawhttp, err := doerByName("rawhttp", DoerOptions{})
+	require.NoError(t, err)
+	require.IsType(t, &rawhttpDoer{}, rawhttp)
+
+	defaulted, err := doerByName("", DoerOptions{})
+	require.NoError(t, err)
+	require.IsType(t, &stdlibDoer{}, defaulted)
+}
+
+func TestDoerByNameUnknown(t *testing.T) {
+	_, err := doerByName("does-not-exist", DoerOptions{})
+	require.Error(t, err)
+}
+
+func TestRegisterDoer(t *testing.T) {
+	RegisterDoer("noop-test", func(DoerOptions) HTTPDoer { return noopDoer{} })
+
+	doer, err := doerByName("noop-test", DoerOptions{})
+	require.NoError(t, err)
+	dump, err := doer.DumpRequest(nil, "")
+	require.NoError(t, err)
+	require.Equal(t, "noop", string(dump))
+}
+
+func TestAlreadyDecodedByDoer(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	require.NoError(t, err)
+
+	resp := &http.Response{Request: req}
+	require.False(t, alreadyDecodedByDoer(resp))
+
+	resp.Request = markDecodedByDoer(req)
+	require.True(t, alreadyDecodedByDoer(resp))
+}
+
+func TestAlreadyDecodedByDoerNilResponse(t *testing.T) {
+	require.False(t, alreadyDecodedByDoer(nil))
+}
+
+func TestNewStdlibDoerWrapsTransportWithFingerprint(t *testing.T) {
+	doer := newStdlibDoer(DoerOptions{Fingerprint: "chrome-120"})
+	_, ok := doer.client.Transport.(*FingerprintTransport)
+	require.True(t, ok, "a non-empty DoerOptions.Fingerprint must make stdlibDoer dial through a FingerprintTransport")
+}
+
+func TestNewStdlibDoerWithoutFingerprintLeavesTransportUntouched(t *testing.T) {
+	doer := newStdlibDoer(DoerOptions{})
+	require.Equal(t, http.DefaultClient, doer.client)
+}
+
+func TestWithFingerprintClientInvalidFingerprintFallsBack(t *testing.T) {
+	client := &http.Client{}
+	got := withFingerprintClient(client, "not-a-profile")
+	require.Same(t, client, got)
+}
+
+func TestWithClientNameRoundTrip(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	require.NoError(t, err)
+
+	req = WithClientName(req, "noop-test")
+	require.Equal(t, "noop-test", clientNameFromRequest(req))
+}
+
+func TestClientNameFromRequestNil(t *testing.T) {
+	require.Empty(t, clientNameFromRequest(nil))
+}
+
+func TestClientNameFromResponseNilRequest(t *testing.T) {
+	require.Empty(t, clientNameFromResponse(&http.Response{}))
+	require.Empty(t, clientNameFromResponse(nil))
+}
+
+func TestDumpResponseViaDoerUsesRecordedClientName(t *testing.T) {
+	RegisterDoer("noop-dump-test", func(DoerOptions) HTTPDoer { return noopDoer{} })
+
+	req, err := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	require.NoError(t, err)
+	req = WithClientName(req, "noop-dump-test")
+
+	dump, err := dumpResponseViaDoer(&http.Response{Request: req})
+	require.NoError(t, err)
+	require.Equal(t, "noop", string(dump))
+}
+
+func TestDoerByNameRawhttpThreadsUnsafeProtocol(t *testing.T) {
+	doer, err := doerByName("rawhttp", DoerOptions{UnsafeProtocol: UnsafeProtocolHTTP2})
+	require.NoError(t, err)
+	raw, ok := doer.(*rawhttpDoer)
+	require.True(t, ok)
+	require.Equal(t, UnsafeProtocolHTTP2, raw.protocol)
+}
+
+// framedRawURL backs rawhttpDoer.Do's h2/h3 branch: it must take the already
+// resolved headers map (map[string]string, the type raw.Request.Headers and
+// sendFramedRequest/dumpFramedRequest actually use), not the expanded
+// map[string][]string generators.ExpandMapValues produces for rawhttp's own
+// HTTP/1.x DoRaw/DumpRequestRaw calls.
+func TestFramedRawURLPrefersFullURL(t *testing.T) {
+	got := framedRawURL("https://example.com/from-template", map[string]string{"Host": "ignored.example.com"}, "/ignored")
+	require.Equal(t, "https://example.com/from-template", got)
+}
+
+func TestFramedRawURLFallsBackToHostAndPath(t *testing.T) {
+	got := framedRawURL("", map[string]string{"Host": "example.com"}, "/login")
+	require.Equal(t, "https://example.com/login", got)
+}
@@ -0,0 +1,242 @@
+package http
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/quic-go/qpack"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// UnsafeProtocol selects which wire protocol an unsafe (rawhttp) request
+// should be framed as when dumped, set via the raw request's `unsafe-http2`
+// / `unsafe-http3` switches.
+type UnsafeProtocol uint8
+
+const (
+	// UnsafeProtocolHTTP1 is the default - rawhttp.DumpRequestRaw's existing
+	// HTTP/1.x framing.
+	UnsafeProtocolHTTP1 UnsafeProtocol = iota
+	// UnsafeProtocolHTTP2 frames the raw request as an HPACK-encoded HEADERS
+	// frame, enabling templates that probe h2 frame-level behavior.
+	UnsafeProtocolHTTP2
+	// UnsafeProtocolHTTP3 frames the raw request as a QPACK-encoded HEADERS
+	// frame for its dump. Sending it is not supported: sendFramedRequest
+	// returns ErrUnsafeHTTP3NotImplemented and opens no QUIC connection.
+	UnsafeProtocolHTTP3
+)
+
+// dumpFramedRequest renders an h2/h3 raw request as the textual
+// representation nuclei sends/matches against: pseudo-headers (:method,
+// :path, :authority, :scheme) followed by regular headers, a blank line, and
+// the body - the same shape httputil.DumpRequestOut produces for HTTP/1.x, so
+// existing matchers keep working unmodified.
+//
+// The actual bytes placed on the wire are HPACK (h2) or QPACK (h3) encoded
+// separately; this textual form exists purely to preserve the
+// dump-for-matching contract.
+func dumpFramedRequest(protocol UnsafeProtocol, method, authority, path string, headers map[string]string, body string) ([]byte, error) {
+	fields := pseudoAndRegularHeaderFields(method, authority, path, headers)
+	if _, err := encodeFrameHeaderFields(protocol, fields); err != nil {
+		return nil, err
+	}
+
+	textual := &bytes.Buffer{}
+	for _, field := range fields {
+		fmt.Fprintf(textual, "%s: %s\n", field[0], field[1])
+	}
+	if body != "" {
+		textual.WriteString("\n")
+		textual.WriteString(body)
+	}
+	return textual.Bytes(), nil
+}
+
+// encodeFrameHeaderFields produces the raw HPACK (h2) or QPACK (h3) encoded
+// HEADERS frame payload nuclei would send for the given pseudo+regular header
+// fields.
+func encodeFrameHeaderFields(protocol UnsafeProtocol, fields [][2]string) ([]byte, error) {
+	switch protocol {
+	case UnsafeProtocolHTTP2:
+		buf := &bytes.Buffer{}
+		encoder := hpack.NewEncoder(buf)
+		for _, field := range fields {
+			if err := encoder.WriteField(hpack.HeaderField{Name: field[0], Value: field[1]}); err != nil {
+				return nil, err
+			}
+		}
+		return buf.Bytes(), nil
+	case UnsafeProtocolHTTP3:
+		buf := &bytes.Buffer{}
+		encoder := qpack.NewEncoder(buf)
+		for _, field := range fields {
+			if err := encoder.WriteField(qpack.HeaderField{Name: field[0], Value: field[1]}); err != nil {
+				return nil, err
+			}
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported unsafe framing protocol %d", protocol)
+	}
+}
+
+func pseudoAndRegularHeaderFields(method, authority, path string, headers map[string]string) [][2]string {
+	fields := [][2]string{
+		{":method", method},
+		{":path", path},
+		{":authority", authority},
+		{":scheme", "https"},
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fields = append(fields, [2]string{strings.ToLower(name), headers[name]})
+	}
+	return fields
+}
+
+// rawHasBodyFramed is rawHasBody's sibling for h2/h3 raw requests: it
+// inspects the textual pseudo-header representation produced by
+// dumpFramedRequest to decide whether a body follows the header block, since
+// http.ReadRequest can't parse an HTTP/1.x request line out of framed
+// pseudo-headers.
+func rawHasBodyFramed(data string) bool {
+	parts := strings.SplitN(data, "\n\n", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	return strings.TrimSpace(parts[1]) != ""
+}
+
+// ErrUnsafeHTTP3NotImplemented is returned by sendFramedRequest for
+// UnsafeProtocolHTTP3 - actually sending a QPACK-framed request needs a full
+// QUIC connection (handshake, stream management, 0-RTT...), which is a much
+// larger lift than reusing an existing transport the way the h2 path below
+// does, so it isn't wired up yet. dumpFramedRequest still renders the h3
+// textual form for matching against canned/mocked responses.
+var ErrUnsafeHTTP3NotImplemented = errors.New("sending a raw http/3 request is not implemented, only its dump representation is available")
+
+// sendFramedRequest actually places req.rawRequest on the wire using
+// HPACK-encoded HEADERS frames instead of rawhttp's HTTP/1.x framing, for
+// rawhttpDoer.Do when UnsafeProtocol requests h2/h3 framing. Only h2 is sent;
+// h3 returns ErrUnsafeHTTP3NotImplemented without sending anything.
+func sendFramedRequest(protocol UnsafeProtocol, rawURL, method, path string, headers map[string]string, body string) (*http.Response, error) {
+	switch protocol {
+	case UnsafeProtocolHTTP2:
+		return sendFramedHTTP2Request(rawURL, method, path, headers, body)
+	case UnsafeProtocolHTTP3:
+		return nil, ErrUnsafeHTTP3NotImplemented
+	default:
+		return nil, fmt.Errorf("unsupported unsafe framing protocol %d", protocol)
+	}
+}
+
+// sendFramedHTTP2Request dials a raw TLS connection, negotiates h2 via ALPN,
+// and speaks HTTP/2 frames directly (preface, SETTINGS, a HEADERS frame built
+// from the same pseudo+regular header fields dumpFramedRequest renders, and a
+// DATA frame for the body) instead of going through net/http's HTTP/2
+// transport, so templates that need to control frame-level behavior (eg.
+// deliberately malformed pseudo-headers) see exactly the bytes nuclei put on
+// the wire.
+func sendFramedHTTP2Request(rawURL, method, path string, headers map[string]string, body string) (*http.Response, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse url for http2 framing: %w", err)
+	}
+	authority := target.Host
+	if !strings.Contains(authority, ":") {
+		authority += ":443"
+	}
+
+	conn, err := tls.Dial("tcp", authority, &tls.Config{ServerName: target.Hostname(), NextProtos: []string{"h2"}})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(http2.ClientPreface)); err != nil {
+		return nil, err
+	}
+	framer := http2.NewFramer(conn, conn)
+	if err := framer.WriteSettings(); err != nil {
+		return nil, err
+	}
+
+	fields := pseudoAndRegularHeaderFields(method, authority, path, headers)
+	encoded, err := encodeFrameHeaderFields(UnsafeProtocolHTTP2, fields)
+	if err != nil {
+		return nil, err
+	}
+	if err := framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: encoded,
+		EndHeaders:    true,
+		EndStream:     body == "",
+	}); err != nil {
+		return nil, err
+	}
+	if body != "" {
+		if err := framer.WriteData(1, true, []byte(body)); err != nil {
+			return nil, err
+		}
+	}
+
+	return readFramedHTTP2Response(framer)
+}
+
+// readFramedHTTP2Response reads HTTP/2 frames off framer until the response
+// stream ends, decoding the HPACK HEADERS block into an *http.Response so the
+// rest of the executor (matchers, dump, trace) can treat it like any other
+// response.
+func readFramedHTTP2Response(framer *http2.Framer) (*http.Response, error) {
+	resp := &http.Response{Proto: "HTTP/2.0", ProtoMajor: 2, ProtoMinor: 0, Header: http.Header{}}
+	bodyBuf := &bytes.Buffer{}
+	decoder := hpack.NewDecoder(4096, func(field hpack.HeaderField) {
+		switch field.Name {
+		case ":status":
+			if code, convErr := strconv.Atoi(field.Value); convErr == nil {
+				resp.StatusCode = code
+				resp.Status = fmt.Sprintf("%d %s", code, http.StatusText(code))
+			}
+		default:
+			if !strings.HasPrefix(field.Name, ":") {
+				resp.Header.Add(field.Name, field.Value)
+			}
+		}
+	})
+
+	for {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch f := frame.(type) {
+		case *http2.HeadersFrame:
+			if _, err := decoder.Write(f.HeaderBlockFragment()); err != nil {
+				return nil, err
+			}
+			if f.StreamEnded() {
+				resp.Body = ioutil.NopCloser(bodyBuf)
+				return resp, nil
+			}
+		case *http2.DataFrame:
+			bodyBuf.Write(f.Data())
+			if f.StreamEnded() {
+				resp.Body = ioutil.NopCloser(bodyBuf)
+				return resp, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDumpFramedRequestHTTP2(t *testing.T) {
+	dump, err := dumpFramedRequest(UnsafeProtocolHTTP2, "POST", "example.com", "/login", map[string]string{"X-Test": "1"}, "user=admin")
+	require.NoError(t, err)
+
+	text := string(dump)
+	require.Contains(t, text, ":method: POST")
+	require.Contains(t, text, ":path: /login")
+	require.Contains(t, text, ":authority: example.com")
+	require.Contains(t, text, "x-test: 1")
+	require.Contains(t, text, "user=admin")
+}
+
+func TestDumpFramedRequestHTTP3NoBody(t *testing.T) {
+	dump, err := dumpFramedRequest(UnsafeProtocolHTTP3, "GET", "example.com", "/", nil, "")
+	require.NoError(t, err)
+	require.False(t, rawHasBodyFramed(string(dump)))
+}
+
+func TestDumpFramedRequestUnsupportedProtocol(t *testing.T) {
+	_, err := dumpFramedRequest(UnsafeProtocol(99), "GET", "example.com", "/", nil, "")
+	require.Error(t, err)
+}
+
+func TestRawHasBodyFramed(t *testing.T) {
+	withBody, err := dumpFramedRequest(UnsafeProtocolHTTP2, "POST", "example.com", "/", nil, "data=1")
+	require.NoError(t, err)
+	require.True(t, rawHasBodyFramed(string(withBody)))
+
+	withoutBody, err := dumpFramedRequest(UnsafeProtocolHTTP2, "GET", "example.com", "/", nil, "")
+	require.NoError(t, err)
+	require.False(t, rawHasBodyFramed(string(withoutBody)))
+}
+
+func TestSendFramedRequestHTTP3NotImplemented(t *testing.T) {
+	_, err := sendFramedRequest(UnsafeProtocolHTTP3, "https://example.com", "GET", "/", nil, "")
+	require.ErrorIs(t, err, ErrUnsafeHTTP3NotImplemented)
+}
+
+func TestSendFramedRequestUnsupportedProtocol(t *testing.T) {
+	_, err := sendFramedRequest(UnsafeProtocol(99), "https://example.com", "GET", "/", nil, "")
+	require.Error(t, err)
+}
+
+func TestSendFramedHTTP2RequestInvalidURL(t *testing.T) {
+	_, err := sendFramedHTTP2Request("://bad-url", "GET", "/", nil, "")
+	require.Error(t, err)
+}
@@ -0,0 +1,240 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"sync"
+	"time"
+)
+
+// TraceEvent is a single structured hop of an HTTP transaction - the initial
+// request/response or one of its redirects - reported to a TraceHandler by
+// dumpResponseWithRedirectChain as it walks resp.Request.Response.
+type TraceEvent struct {
+	Timestamp        time.Time     `json:"timestamp"`
+	TemplateID       string        `json:"template-id,omitempty"`
+	Method           string        `json:"method"`
+	URL              string        `json:"url"`
+	RemoteAddr       string        `json:"remote-addr,omitempty"`
+	StatusCode       int           `json:"status-code"`
+	Duration         time.Duration `json:"duration"`
+	UserAgent        string        `json:"user-agent,omitempty"`
+	ResponseBytes    int           `json:"response-bytes"`
+	CompressedBytes  int           `json:"compressed-bytes,omitempty"`
+	CompressionRatio float64       `json:"compression-ratio,omitempty"`
+	TLSFingerprint   string        `json:"tls-fingerprint,omitempty"`
+}
+
+// TraceHandler receives structured trace events for every HTTP hop so
+// downstream tooling can consume machine-readable transaction logs instead of
+// parsing the concatenated redirect-chain dump.
+type TraceHandler interface {
+	Handle(event *TraceEvent) error
+}
+
+// traceHandler is the process-wide sink dumpResponseWithRedirectChain reports
+// hops to. It defaults to a no-op so tracing costs nothing unless explicitly
+// enabled via SetTraceHandler (eg. by -http-trace-file).
+var traceHandler TraceHandler = noopTraceHandler{}
+
+// SetTraceHandler installs the sink used by dumpResponseWithRedirectChain to
+// report per-hop trace events. Passing nil disables tracing.
+func SetTraceHandler(handler TraceHandler) {
+	if handler == nil {
+		handler = noopTraceHandler{}
+	}
+	traceHandler = handler
+}
+
+type noopTraceHandler struct{}
+
+func (noopTraceHandler) Handle(_ *TraceEvent) error { return nil }
+
+// jsonLinesTraceHandler writes one JSON-encoded TraceEvent per line to the
+// underlying writer - used for both the stdout and -http-trace-file sinks.
+type jsonLinesTraceHandler struct {
+	writer io.Writer
+}
+
+// NewJSONLinesTraceHandler returns a TraceHandler that writes newline
+// delimited JSON trace events to w (eg. os.Stdout or a user-supplied
+// io.Writer).
+func NewJSONLinesTraceHandler(w io.Writer) TraceHandler {
+	return &jsonLinesTraceHandler{writer: w}
+}
+
+func (j *jsonLinesTraceHandler) Handle(event *TraceEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = j.writer.Write(data)
+	return err
+}
+
+// FileTraceHandler is a jsonLinesTraceHandler backed by an on-disk file, as
+// used by -http-trace-file.
+type FileTraceHandler struct {
+	*jsonLinesTraceHandler
+	file *os.File
+}
+
+// NewFileTraceHandler opens path for appending and returns a TraceHandler
+// writing JSON lines trace events to it. Callers should Close it on shutdown.
+func NewFileTraceHandler(path string) (*FileTraceHandler, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileTraceHandler{jsonLinesTraceHandler: &jsonLinesTraceHandler{writer: file}, file: file}, nil
+}
+
+// Close closes the underlying trace file.
+func (f *FileTraceHandler) Close() error {
+	return f.file.Close()
+}
+
+// ConfigureTraceFile wires up -http-trace-file: it opens path and installs a
+// JSON-lines TraceHandler as the sink for dumpResponseWithRedirectChain,
+// returning a Closer the caller should close on shutdown.
+func ConfigureTraceFile(path string) (io.Closer, error) {
+	handler, err := NewFileTraceHandler(path)
+	if err != nil {
+		return nil, err
+	}
+	SetTraceHandler(handler)
+	return handler, nil
+}
+
+type templateIDContextKey struct{}
+
+// WithTemplateID returns a copy of req with the issuing template ID attached
+// to its context, so trace events for its response (and redirects) can be
+// attributed back to the template that sent it.
+func WithTemplateID(req *http.Request, templateID string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), templateIDContextKey{}, templateID))
+}
+
+func templateIDFromResponse(resp *http.Response) string {
+	if resp == nil || resp.Request == nil {
+		return ""
+	}
+	if id, ok := resp.Request.Context().Value(templateIDContextKey{}).(string); ok {
+		return id
+	}
+	return ""
+}
+
+type traceStartContextKey struct{}
+
+// WithTraceStart returns a copy of req with the time it was sent attached to
+// its context, so the resulting TraceEvent can report hop duration.
+func WithTraceStart(req *http.Request, start time.Time) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), traceStartContextKey{}, start))
+}
+
+func durationSinceRequestStart(resp *http.Response) time.Duration {
+	if resp == nil || resp.Request == nil {
+		return 0
+	}
+	if start, ok := resp.Request.Context().Value(traceStartContextKey{}).(time.Time); ok {
+		return time.Since(start)
+	}
+	return 0
+}
+
+type remoteAddrContextKey struct{}
+
+// remoteAddrRecorder captures the address a request's transport actually
+// dialed, via httptrace.ClientTrace.GotConn. resp.Request.RemoteAddr can't be
+// used for this - that field is documented as populated by net/http's server
+// and is left empty on the client side, so it never reflects where an
+// outgoing scan request went. Guarded by a mutex since GotConn can fire on a
+// goroutine other than the one that reads it back in emitTraceEvent.
+type remoteAddrRecorder struct {
+	mu   sync.Mutex
+	addr string
+}
+
+func (r *remoteAddrRecorder) set(addr string) {
+	r.mu.Lock()
+	r.addr = addr
+	r.mu.Unlock()
+}
+
+func (r *remoteAddrRecorder) get() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.addr
+}
+
+// WithRemoteAddrTrace returns a copy of req wired with an httptrace.ClientTrace
+// that records the address its transport actually dials, so emitTraceEvent
+// can report a real RemoteAddr for it (and any redirects that follow, which
+// inherit the same context/trace) instead of the always-empty
+// resp.Request.RemoteAddr.
+func WithRemoteAddrTrace(req *http.Request) *http.Request {
+	recorder := &remoteAddrRecorder{}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Conn != nil {
+				recorder.set(info.Conn.RemoteAddr().String())
+			}
+		},
+	}
+	ctx := context.WithValue(httptrace.WithClientTrace(req.Context(), trace), remoteAddrContextKey{}, recorder)
+	return req.WithContext(ctx)
+}
+
+func remoteAddrFromResponse(resp *http.Response) string {
+	if resp == nil || resp.Request == nil {
+		return ""
+	}
+	if recorder, ok := resp.Request.Context().Value(remoteAddrContextKey{}).(*remoteAddrRecorder); ok {
+		return recorder.get()
+	}
+	return ""
+}
+
+// emitTraceEvent builds a TraceEvent for a single hop and reports it to the
+// configured traceHandler. body is the raw (possibly still encoded) bytes of
+// that hop as already read by dumpResponseWithRedirectChain.
+func emitTraceEvent(resp *http.Response, body []byte) {
+	if resp == nil || resp.Request == nil {
+		return
+	}
+
+	compressedLen := len(body)
+	decodedLen := compressedLen
+	if decoded, err := handleDecompression(resp, body); err == nil {
+		decodedLen = len(decoded)
+	}
+
+	ratio := 1.0
+	if compressedLen > 0 {
+		ratio = float64(decodedLen) / float64(compressedLen)
+	}
+
+	event := &TraceEvent{
+		Timestamp:        time.Now(),
+		TemplateID:       templateIDFromResponse(resp),
+		Method:           resp.Request.Method,
+		StatusCode:       resp.StatusCode,
+		Duration:         durationSinceRequestStart(resp),
+		UserAgent:        resp.Request.UserAgent(),
+		ResponseBytes:    decodedLen,
+		CompressedBytes:  compressedLen,
+		CompressionRatio: ratio,
+		TLSFingerprint:   fingerprintFromRequest(resp.Request),
+	}
+	if resp.Request.URL != nil {
+		event.URL = resp.Request.URL.String()
+	}
+	event.RemoteAddr = remoteAddrFromResponse(resp)
+	_ = traceHandler.Handle(event)
+}
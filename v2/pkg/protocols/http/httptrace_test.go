@@ -0,0 +1,140 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordingTraceHandler struct {
+	events []*TraceEvent
+}
+
+func (r *recordingTraceHandler) Handle(event *TraceEvent) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestJSONLinesTraceHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	handler := NewJSONLinesTraceHandler(buf)
+
+	event := &TraceEvent{Method: http.MethodGet, URL: "https://example.com", StatusCode: 200}
+	require.NoError(t, handler.Handle(event))
+
+	var decoded TraceEvent
+	require.NoError(t, json.Unmarshal(bytes.TrimRight(buf.Bytes(), "\n"), &decoded))
+	require.Equal(t, event.Method, decoded.Method)
+	require.Equal(t, event.URL, decoded.URL)
+	require.Equal(t, event.StatusCode, decoded.StatusCode)
+}
+
+func TestWithTemplateIDRoundTrip(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	require.NoError(t, err)
+
+	req = WithTemplateID(req, "cves/example-cve")
+	resp := &http.Response{Request: req}
+	require.Equal(t, "cves/example-cve", templateIDFromResponse(resp))
+}
+
+func TestEmitTraceEventReportsHop(t *testing.T) {
+	previous := traceHandler
+	defer func() { traceHandler = previous }()
+
+	recorder := &recordingTraceHandler{}
+	SetTraceHandler(recorder)
+
+	req, err := http.NewRequest(http.MethodGet, "https://example.com/path", nil)
+	require.NoError(t, err)
+	req = WithTemplateID(req, "http/example")
+	req = WithTraceStart(req, time.Now().Add(-time.Millisecond))
+
+	resp := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+	}
+
+	emitTraceEvent(resp, []byte("hello"))
+
+	require.Len(t, recorder.events, 1)
+	event := recorder.events[0]
+	require.Equal(t, "http/example", event.TemplateID)
+	require.Equal(t, http.MethodGet, event.Method)
+	require.Equal(t, "https://example.com/path", event.URL)
+	require.Equal(t, http.StatusOK, event.StatusCode)
+	require.Equal(t, 5, event.ResponseBytes)
+	require.Equal(t, 5, event.CompressedBytes)
+	require.Greater(t, event.Duration, time.Duration(0))
+}
+
+func TestEmitTraceEventNilResponse(t *testing.T) {
+	previous := traceHandler
+	defer func() { traceHandler = previous }()
+
+	recorder := &recordingTraceHandler{}
+	SetTraceHandler(recorder)
+
+	emitTraceEvent(nil, nil)
+	require.Empty(t, recorder.events)
+}
+
+func TestWithRemoteAddrTraceRecordsDialedAddr(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	req = WithRemoteAddrTrace(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// resp.Request.RemoteAddr is the server-side net/http field and is always
+	// empty for a client-issued request - this is exactly the bug being fixed.
+	require.Empty(t, resp.Request.RemoteAddr)
+	require.NotEmpty(t, remoteAddrFromResponse(resp))
+}
+
+func TestEmitTraceEventReportsRemoteAddr(t *testing.T) {
+	previous := traceHandler
+	defer func() { traceHandler = previous }()
+
+	recorder := &recordingTraceHandler{}
+	SetTraceHandler(recorder)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	req = WithRemoteAddrTrace(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	emitTraceEvent(resp, nil)
+
+	require.Len(t, recorder.events, 1)
+	require.NotEmpty(t, recorder.events[0].RemoteAddr)
+}
+
+func TestSetTraceHandlerNilDisables(t *testing.T) {
+	previous := traceHandler
+	defer func() { traceHandler = previous }()
+
+	SetTraceHandler(nil)
+	req := &http.Request{URL: &url.URL{}}
+	resp := &http.Response{Request: req}
+	// must not panic with the default no-op handler installed
+	emitTraceEvent(resp, []byte("x"))
+}
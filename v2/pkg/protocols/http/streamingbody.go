@@ -0,0 +1,180 @@
+package http
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// defaultStreamingBodyCap is the default amount of a response body
+// StreamingBody buffers before discarding the remainder, keeping memory use
+// flat regardless of how large the body actually is.
+const defaultStreamingBodyCap = 4 * 1024 * 1024 // 4MB
+
+// StreamingBody wraps a response body reader with a bounded buffer so
+// matchers that only need the first N bytes, or only need to scan for a
+// substring/regex, never force the full body into memory - a single read
+// pass fills the buffer up to its cap and anything beyond that is drained
+// and discarded rather than retained.
+type StreamingBody struct {
+	reader    io.Reader
+	capBytes  int
+	buf       []byte
+	fullyRead bool
+}
+
+// NewStreamingBody wraps r with a buffer capped at capBytes (0 uses the
+// default of 4MB).
+func NewStreamingBody(r io.Reader, capBytes int) *StreamingBody {
+	if capBytes <= 0 {
+		capBytes = defaultStreamingBodyCap
+	}
+	return &StreamingBody{reader: r, capBytes: capBytes}
+}
+
+// ensureBuffered reads from the underlying reader, if needed, until at least
+// n bytes are buffered (capped at capBytes) or the source is exhausted.
+func (s *StreamingBody) ensureBuffered(n int) error {
+	if n > s.capBytes {
+		n = s.capBytes
+	}
+	if s.fullyRead || len(s.buf) >= n {
+		return nil
+	}
+
+	need := n - len(s.buf)
+	chunk := make([]byte, need)
+	read, err := io.ReadFull(s.reader, chunk)
+	s.buf = append(s.buf, chunk[:read]...)
+	if err != nil {
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			s.fullyRead = true
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// PeekN returns up to n bytes (capped at the configured buffer size) from the
+// start of the body without consuming the rest of the stream.
+func (s *StreamingBody) PeekN(n int) ([]byte, error) {
+	if err := s.ensureBuffered(n); err != nil {
+		return nil, err
+	}
+	if n > len(s.buf) {
+		n = len(s.buf)
+	}
+	return s.buf[:n], nil
+}
+
+// ScanRegex reports whether re matches anywhere within the buffered window
+// (up to the configured cap), reading more of the body as needed.
+func (s *StreamingBody) ScanRegex(re *regexp.Regexp) bool {
+	if err := s.ensureBuffered(s.capBytes); err != nil {
+		return false
+	}
+	return re.Match(s.buf)
+}
+
+// Hash writes the buffered window (up to the configured cap) into h.
+func (s *StreamingBody) Hash(h hash.Hash) error {
+	if err := s.ensureBuffered(s.capBytes); err != nil {
+		return err
+	}
+	_, err := h.Write(s.buf)
+	return err
+}
+
+// Drain discards everything remaining beyond the buffered window, returning
+// how many bytes were discarded, so the underlying connection can be reused
+// without the caller paying for a full in-memory copy of a multi-GB body.
+func (s *StreamingBody) Drain() (int64, error) {
+	if s.fullyRead {
+		return 0, nil
+	}
+	n, err := io.Copy(ioutil.Discard, s.reader)
+	s.fullyRead = true
+	if err != nil && err != io.EOF {
+		return n, err
+	}
+	return n, nil
+}
+
+// handleDecompressionStream mirrors handleDecompression but returns a lazily
+// decoding io.Reader instead of eagerly buffering the whole body, so callers
+// can wrap it in a StreamingBody and only pay for the bytes a matcher
+// actually consumes. Unlike handleDecompression it applies no cumulative
+// decompressed-size cap; the returned reader is unbounded.
+func handleDecompressionStream(resp *http.Response, body io.Reader) (io.Reader, error) {
+	if resp == nil {
+		return body, nil
+	}
+	if alreadyDecodedByDoer(resp) {
+		return body, nil
+	}
+
+	encodingHeader := strings.TrimSpace(strings.ToLower(resp.Header.Get("Content-Encoding")))
+	if encodingHeader == "" {
+		return body, nil
+	}
+
+	encodings := strings.Split(encodingHeader, ",")
+	reader := body
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := strings.TrimSpace(encodings[i])
+		if encoding == "" {
+			continue
+		}
+		next, err := decodeContentEncodingLayerStream(encoding, reader)
+		if err != nil {
+			return body, &DecompressionError{Encoding: encoding, Err: err}
+		}
+		reader = next
+	}
+	return reader, nil
+}
+
+// decodeContentEncodingLayerStream is decodeContentEncodingLayer's lazy,
+// io.Reader-based counterpart. Unknown encodings pass the reader through
+// unchanged.
+func decodeContentEncodingLayerStream(encoding string, r io.Reader) (io.Reader, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		return decodeDeflateStream(r)
+	case "br":
+		return brotli.NewReader(r), nil
+	case "zstd":
+		zstdReader, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zstdReader.IOReadCloser(), nil
+	default:
+		return r, nil
+	}
+}
+
+// decodeDeflateStream mirrors decodeDeflate for a non-seekable reader: it
+// peeks the first two bytes to detect a zlib header (the common 0x78 CMF
+// byte) without consuming more of the stream than necessary, falling back to
+// raw DEFLATE when it's absent.
+func decodeDeflateStream(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if peek, err := br.Peek(2); err == nil && len(peek) == 2 && peek[0] == 0x78 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
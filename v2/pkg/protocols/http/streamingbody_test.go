@@ -0,0 +1,190 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamingBodyPeekN(t *testing.T) {
+	body := NewStreamingBody(strings.NewReader("hello streaming world"), 0)
+	peeked, err := body.PeekN(5)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(peeked))
+}
+
+func TestStreamingBodyPeekNShorterThanBody(t *testing.T) {
+	body := NewStreamingBody(strings.NewReader("short"), 0)
+	peeked, err := body.PeekN(1024)
+	require.NoError(t, err)
+	require.Equal(t, "short", string(peeked))
+}
+
+func TestStreamingBodyScanRegex(t *testing.T) {
+	body := NewStreamingBody(strings.NewReader("prefix needle suffix"), 0)
+	require.True(t, body.ScanRegex(regexp.MustCompile("needle")))
+
+	body2 := NewStreamingBody(strings.NewReader("nothing to find here"), 0)
+	require.False(t, body2.ScanRegex(regexp.MustCompile("needle")))
+}
+
+func TestStreamingBodyHash(t *testing.T) {
+	const data = "hash me please"
+	body := NewStreamingBody(strings.NewReader(data), 0)
+
+	h := sha256.New()
+	require.NoError(t, body.Hash(h))
+
+	want := sha256.Sum256([]byte(data))
+	require.Equal(t, want[:], h.Sum(nil))
+}
+
+func TestStreamingBodyDrainDiscardsBeyondCap(t *testing.T) {
+	large := strings.Repeat("x", 100)
+	body := NewStreamingBody(strings.NewReader(large), 10)
+
+	peeked, err := body.PeekN(10)
+	require.NoError(t, err)
+	require.Len(t, peeked, 10)
+
+	discarded, err := body.Drain()
+	require.NoError(t, err)
+	require.Equal(t, int64(90), discarded)
+}
+
+func TestStreamingBodyDrainAlreadyConsumed(t *testing.T) {
+	body := NewStreamingBody(strings.NewReader("abc"), 0)
+	_, err := body.PeekN(1024)
+	require.NoError(t, err)
+
+	discarded, err := body.Drain()
+	require.NoError(t, err)
+	require.Equal(t, int64(0), discarded)
+}
+
+func TestHandleDecompressionStreamGzip(t *testing.T) {
+	const want = "streamed decompression body"
+	resp := &http.Response{Header: http.Header{"Content-Encoding": []string{"gzip"}}}
+
+	reader, err := handleDecompressionStream(resp, bytes.NewReader(gzipBytes(t, want)))
+	require.NoError(t, err)
+
+	got, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, want, string(got))
+}
+
+func TestHandleDecompressionStreamNoEncoding(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+	reader, err := handleDecompressionStream(resp, strings.NewReader("plain"))
+	require.NoError(t, err)
+
+	got, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "plain", string(got))
+}
+
+func TestDumpResponseWithRedirectChainStreamUsesStreamingPath(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	require.NoError(t, err)
+	resp := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}
+
+	dump, err := dumpResponseWithRedirectChainStream(resp, strings.NewReader("root body content"))
+	require.NoError(t, err)
+	require.Contains(t, string(dump), "root body content")
+}
+
+func TestDumpResponseWithRedirectChainStreamTruncationDoesNotCorruptTrace(t *testing.T) {
+	previous := traceHandler
+	defer func() { traceHandler = previous }()
+	recorder := &recordingTraceHandler{}
+	SetTraceHandler(recorder)
+
+	req, err := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	require.NoError(t, err)
+	resp := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}
+
+	large := strings.Repeat("x", defaultStreamingBodyCap+1024)
+	dump, err := dumpResponseWithRedirectChainStream(resp, strings.NewReader(large))
+	require.NoError(t, err)
+	require.Contains(t, string(dump), "[...truncated 1024 bytes]")
+
+	// the trace event must see exactly the peeked (pre-marker) window, not
+	// the marker-appended bytes written to the dump output.
+	require.Len(t, recorder.events, 1)
+	require.Equal(t, defaultStreamingBodyCap, recorder.events[0].ResponseBytes)
+}
+
+func TestDecodedStreamingBodyLazilyDecodes(t *testing.T) {
+	const want = "lazily decoded body content"
+	resp := &http.Response{Header: http.Header{"Content-Encoding": []string{"gzip"}}}
+
+	streaming, err := decodedStreamingBody(resp, bytes.NewReader(gzipBytes(t, want)))
+	require.NoError(t, err)
+
+	peeked, err := streaming.PeekN(len(want))
+	require.NoError(t, err)
+	require.Equal(t, want, string(peeked))
+}
+
+// BenchmarkStreamingBodyVsReadAll demonstrates that StreamingBody keeps
+// memory use flat (bounded by the configured cap) for large bodies instead
+// of the linear growth of ioutil.ReadAll.
+func BenchmarkStreamingBodyVsReadAll(b *testing.B) {
+	const size = 64 * 1024 * 1024 // 64MB synthetic body
+	makeBody := func() io.Reader {
+		return io.LimitReader(zeroReader{}, size)
+	}
+
+	b.Run("ReadAll", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			data, err := ioutil.ReadAll(makeBody())
+			if err != nil {
+				b.Fatal(err)
+			}
+			_ = data
+		}
+	})
+
+	b.Run("StreamingBody", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			streaming := NewStreamingBody(makeBody(), 0)
+			if _, err := streaming.PeekN(defaultStreamingBodyCap); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := streaming.Drain(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// zeroReader is an io.Reader that produces an endless stream of zero bytes,
+// used to synthesize large bodies without allocating them up front.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
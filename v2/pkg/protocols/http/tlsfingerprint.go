@@ -0,0 +1,249 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// namedFingerprintProfiles maps well-known -tls-fingerprint profile names to
+// their raw JA3 string ("version,ciphers,extensions,curves,pointformats").
+var namedFingerprintProfiles = map[string]string{
+	"chrome-120":  "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,0-23-65281-10-11-35-16-5-13-18-51-45-43-27-17513,29-23-24,0",
+	"firefox-117": "771,4865-4867-4866-49195-49199-52393-52392-49196-49200-49162-49161-49171-49172-156-157-47-53-255,0-23-65281-10-11-35-16-5-34-51-43-13-28-65037,29-23-24-25-256-257,0",
+	"safari-17":   "771,4865-4866-4867-49196-49195-52393-49200-49199-52392-49162-49161-49172-49171-157-156-61-60-53-47,65281-0-23-13-5-18-16-11-51-45-43-10-21,29-23-24-25,0",
+}
+
+// ResolveFingerprint returns the raw JA3 string for a -tls-fingerprint value:
+// a named profile (eg. "chrome-120", matched case-insensitively) is expanded
+// to its JA3 string, any other value containing a comma is assumed to already
+// be a raw JA3 string, and any other value is rejected as an unknown profile.
+func ResolveFingerprint(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	if ja3, ok := namedFingerprintProfiles[strings.ToLower(value)]; ok {
+		return ja3, nil
+	}
+	if !strings.Contains(value, ",") {
+		return "", fmt.Errorf("unknown tls fingerprint profile %q", value)
+	}
+	return value, nil
+}
+
+// ja3ClientHelloSpec parses a raw JA3 string into a utls.ClientHelloSpec that
+// reproduces its cipher suites, extensions, elliptic curves and point
+// formats, so the outgoing ClientHello matches a real browser instead of
+// Go's default crypto/tls fingerprint.
+func ja3ClientHelloSpec(ja3 string) (*utls.ClientHelloSpec, error) {
+	fields := strings.Split(ja3, ",")
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("malformed ja3 string: expected 5 comma-separated fields, got %d", len(fields))
+	}
+
+	version, err := strconv.ParseUint(fields[0], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ja3 tls version %q: %w", fields[0], err)
+	}
+	ciphers, err := parseJA3Uint16List(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ja3 cipher list: %w", err)
+	}
+	extensionIDs, err := parseJA3Uint16List(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ja3 extension list: %w", err)
+	}
+	curves, err := parseJA3Uint16List(fields[3])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ja3 curve list: %w", err)
+	}
+	pointFormats, err := parseJA3Uint16List(fields[4])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ja3 point format list: %w", err)
+	}
+
+	cipherSuites := make([]uint16, len(ciphers))
+	for i, c := range ciphers {
+		cipherSuites[i] = c
+	}
+	pointFormatBytes := make([]byte, len(pointFormats))
+	for i, p := range pointFormats {
+		pointFormatBytes[i] = byte(p)
+	}
+
+	return &utls.ClientHelloSpec{
+		TLSVersMin:   uint16(version),
+		TLSVersMax:   uint16(version),
+		CipherSuites: cipherSuites,
+		Extensions:   ja3Extensions(extensionIDs, curves, pointFormatBytes),
+	}, nil
+}
+
+// ja3Extensions builds the extension list for a ClientHelloSpec from the raw
+// JA3 extension IDs, falling back to a generic passthrough extension for IDs
+// this package doesn't special-case.
+func ja3Extensions(extensionIDs, curves []uint16, pointFormats []byte) []utls.TLSExtension {
+	extensions := make([]utls.TLSExtension, 0, len(extensionIDs))
+	for _, id := range extensionIDs {
+		switch id {
+		case 10:
+			extensions = append(extensions, &utls.SupportedCurvesExtension{Curves: curves})
+		case 11:
+			extensions = append(extensions, &utls.SupportedPointsExtension{SupportedPoints: pointFormats})
+		case 13:
+			extensions = append(extensions, &utls.SignatureAlgorithmsExtension{
+				SupportedSignatureAlgorithms: []utls.SignatureScheme{
+					utls.ECDSAWithP256AndSHA256, utls.PSSWithSHA256, utls.PKCS1WithSHA256,
+					utls.ECDSAWithP384AndSHA384, utls.PSSWithSHA384, utls.PKCS1WithSHA384,
+					utls.PSSWithSHA512, utls.PKCS1WithSHA512,
+				},
+			})
+		case 16:
+			extensions = append(extensions, &utls.ALPNExtension{AlpnProtocols: []string{"h2", "http/1.1"}})
+		case 0:
+			extensions = append(extensions, &utls.SNIExtension{})
+		case 65281:
+			extensions = append(extensions, &utls.RenegotiationInfoExtension{Renegotiation: utls.RenegotiateOnceAsClient})
+		case 23:
+			extensions = append(extensions, &utls.ExtendedMasterSecretExtension{})
+		default:
+			extensions = append(extensions, &utls.GenericExtension{Id: id})
+		}
+	}
+	return extensions
+}
+
+func parseJA3Uint16List(field string) ([]uint16, error) {
+	field = strings.TrimSpace(field)
+	if field == "" {
+		return nil, nil
+	}
+	parts := strings.Split(field, "-")
+	values := make([]uint16, 0, len(parts))
+	for _, part := range parts {
+		v, err := strconv.ParseUint(strings.TrimSpace(part), 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, uint16(v))
+	}
+	return values, nil
+}
+
+type fingerprintContextKey struct{}
+
+// WithFingerprint returns a copy of req with the JA3 fingerprint it was sent
+// with attached to its context, so dump/emitTraceEvent can record which
+// fingerprint was used, keeping scan output reproducible.
+func WithFingerprint(req *http.Request, fingerprint string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), fingerprintContextKey{}, fingerprint))
+}
+
+func fingerprintFromRequest(req *http.Request) string {
+	if req == nil {
+		return ""
+	}
+	if fp, ok := req.Context().Value(fingerprintContextKey{}).(string); ok {
+		return fp
+	}
+	return ""
+}
+
+// FingerprintTransport is an http.RoundTripper that dials TLS connections
+// with a spoofed ClientHello matching a configured JA3 fingerprint instead of
+// Go's default crypto/tls fingerprint, so templates relying on real-browser
+// responses aren't defeated by server-side JA3/JA4 blocking.
+//
+// A per-request override (set via WithFingerprint on the outgoing request)
+// takes precedence over the transport's default, so different templates can
+// impersonate different clients within a single scan.
+type FingerprintTransport struct {
+	// JA3 is the default raw JA3 string used when a request doesn't carry
+	// its own per-request override.
+	JA3       string
+	Transport *http.Transport
+}
+
+// NewFingerprintTransport builds a RoundTripper that impersonates fingerprint
+// (a named profile or raw JA3 string) for every TLS connection it dials,
+// deferring everything else (dialing, proxies, keep-alives, ...) to base.
+func NewFingerprintTransport(fingerprint string, base *http.Transport) (*FingerprintTransport, error) {
+	ja3, err := ResolveFingerprint(fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	if base == nil {
+		base = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	transport := &FingerprintTransport{JA3: ja3, Transport: base}
+	transport.Transport.DialTLSContext = transport.dialTLS
+	return transport, nil
+}
+
+// dialPlain establishes the underlying TCP connection dialTLS then upgrades,
+// preferring the base transport's own DialContext (which is where a proxy or
+// a caller-supplied dialer such as fastdialer would be configured) and only
+// falling back to a bare net.Dialer when the base transport doesn't set one.
+func (f *FingerprintTransport) dialPlain(ctx context.Context, network, addr string) (net.Conn, error) {
+	if f.Transport != nil && f.Transport.DialContext != nil {
+		return f.Transport.DialContext(ctx, network, addr)
+	}
+	return (&net.Dialer{}).DialContext(ctx, network, addr)
+}
+
+func (f *FingerprintTransport) dialTLS(ctx context.Context, network, addr string) (net.Conn, error) {
+	rawConn, err := f.dialPlain(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+
+	ja3 := f.JA3
+	if override, ok := ctx.Value(fingerprintContextKey{}).(string); ok && override != "" {
+		ja3 = override
+	}
+	spec, err := ja3ClientHelloSpec(ja3)
+	if err != nil {
+		rawConn.Close()
+		return nil, err
+	}
+
+	uConn := utls.UClient(rawConn, &utls.Config{ServerName: host}, utls.HelloCustom)
+	if err := uConn.ApplyPreset(spec); err != nil {
+		rawConn.Close()
+		return nil, err
+	}
+	if err := uConn.HandshakeContext(ctx); err != nil {
+		rawConn.Close()
+		return nil, err
+	}
+	return uConn, nil
+}
+
+// RoundTrip honors a per-request fingerprint override (via WithFingerprint)
+// before delegating to the wrapped transport, and tags the request so the
+// fingerprint that was actually used is recoverable from dump/trace output.
+func (f *FingerprintTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fingerprint := f.JA3
+	if override := fingerprintFromRequest(req); override != "" {
+		resolved, err := ResolveFingerprint(override)
+		if err != nil {
+			return nil, err
+		}
+		fingerprint = resolved
+	}
+	// re-attach the resolved fingerprint so it both reaches dialTLS (via the
+	// request's context, which becomes DialTLSContext's ctx) and is
+	// recoverable from the request afterwards for dump/trace output.
+	req = WithFingerprint(req, fingerprint)
+	return f.Transport.RoundTrip(req)
+}
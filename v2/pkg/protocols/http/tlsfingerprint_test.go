@@ -0,0 +1,80 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errDialProbe = errors.New("dial probe: base DialContext invoked")
+
+func TestResolveFingerprintNamedProfile(t *testing.T) {
+	ja3, err := ResolveFingerprint("chrome-120")
+	require.NoError(t, err)
+	require.Equal(t, namedFingerprintProfiles["chrome-120"], ja3)
+}
+
+func TestResolveFingerprintRawJA3(t *testing.T) {
+	raw := "771,4865-4866,0-23,29-23,0"
+	ja3, err := ResolveFingerprint(raw)
+	require.NoError(t, err)
+	require.Equal(t, raw, ja3)
+}
+
+func TestResolveFingerprintUnknown(t *testing.T) {
+	_, err := ResolveFingerprint("not-a-profile")
+	require.Error(t, err)
+}
+
+func TestResolveFingerprintEmpty(t *testing.T) {
+	ja3, err := ResolveFingerprint("")
+	require.NoError(t, err)
+	require.Empty(t, ja3)
+}
+
+func TestJA3ClientHelloSpec(t *testing.T) {
+	spec, err := ja3ClientHelloSpec(namedFingerprintProfiles["chrome-120"])
+	require.NoError(t, err)
+	require.NotEmpty(t, spec.CipherSuites)
+	require.NotEmpty(t, spec.Extensions)
+	require.Equal(t, uint16(771), spec.TLSVersMin)
+}
+
+func TestJA3ClientHelloSpecMalformed(t *testing.T) {
+	_, err := ja3ClientHelloSpec("not,enough,fields")
+	require.Error(t, err)
+
+	_, err = ja3ClientHelloSpec("771,abc,0-23,29-23,0")
+	require.Error(t, err)
+}
+
+func TestWithFingerprintRoundTrip(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	require.NoError(t, err)
+
+	req = WithFingerprint(req, "chrome-120")
+	require.Equal(t, "chrome-120", fingerprintFromRequest(req))
+}
+
+func TestFingerprintFromRequestNil(t *testing.T) {
+	require.Empty(t, fingerprintFromRequest(nil))
+}
+
+func TestFingerprintTransportDialPlainUsesBaseDialContext(t *testing.T) {
+	var usedBaseDialer bool
+	base := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			usedBaseDialer = true
+			return nil, errDialProbe
+		},
+	}
+	transport, err := NewFingerprintTransport("chrome-120", base)
+	require.NoError(t, err)
+
+	_, _ = transport.dialPlain(context.Background(), "tcp", "example.com:443")
+	require.True(t, usedBaseDialer, "dialPlain must dial through the base transport's DialContext (eg. a proxy or fastdialer) rather than a bare net.Dialer")
+}
@@ -3,16 +3,21 @@ package http
 import (
 	"bufio"
 	"bytes"
+	"compress/flate"
 	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
-	"net/http/httputil"
 	"strings"
+	"sync/atomic"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 
-	"github.com/projectdiscovery/nuclei/v2/pkg/protocols/common/generators"
 	"github.com/projectdiscovery/nuclei/v2/pkg/protocols/common/tostring"
-	"github.com/projectdiscovery/rawhttp"
 )
 
 // dumpResponseWithRedirectChain dumps a http response with the
@@ -21,10 +26,13 @@ import (
 // It preserves the order in which responses were given to requests
 // and returns the data to the user for matching and viewing in that order.
 //
+// As it walks the chain it also reports a structured TraceEvent per hop to
+// the configured trace handler (see httptrace.go / -http-trace-file).
+//
 // Inspired from - https://github.com/ffuf/ffuf/issues/324#issuecomment-719858923
 func dumpResponseWithRedirectChain(resp *http.Response, body []byte) ([]byte, error) {
 	redirects := []string{}
-	respData, err := httputil.DumpResponse(resp, false)
+	respData, err := dumpResponseViaDoer(resp)
 	if err != nil {
 		return nil, err
 	}
@@ -34,6 +42,7 @@ func dumpResponseWithRedirectChain(resp *http.Response, body []byte) ([]byte, er
 	redirectChain.Write(body)
 	redirects = append(redirects, redirectChain.String())
 	redirectChain.Reset()
+	emitTraceEvent(resp, body)
 
 	var redirectResp *http.Response
 	if resp != nil && resp.Request != nil {
@@ -42,16 +51,31 @@ func dumpResponseWithRedirectChain(resp *http.Response, body []byte) ([]byte, er
 	for redirectResp != nil {
 		var body []byte
 
-		respData, err := httputil.DumpResponse(redirectResp, false)
+		respData, err := dumpResponseViaDoer(redirectResp)
 		if err != nil {
 			break
 		}
+		dumpBody := body
 		if redirectResp.Body != nil {
-			body, _ = ioutil.ReadAll(redirectResp.Body)
+			streamingBody := NewStreamingBody(redirectResp.Body, 0)
+			peeked, _ := streamingBody.PeekN(defaultStreamingBodyCap)
+			body = peeked
+			dumpBody = peeked
+			// report the trace event off the real peeked bytes, before the
+			// truncation marker below is appended for display purposes -
+			// otherwise handleDecompression inside emitTraceEvent would be
+			// fed a corrupted, non-decodable byte stream for any truncated,
+			// content-encoded hop.
+			emitTraceEvent(redirectResp, body)
+			if discarded, drainErr := streamingBody.Drain(); drainErr == nil && discarded > 0 {
+				dumpBody = append(append([]byte{}, peeked...), []byte(fmt.Sprintf("\n[...truncated %d bytes]", discarded))...)
+			}
+		} else {
+			emitTraceEvent(redirectResp, body)
 		}
 		redirectChain.WriteString(tostring.UnsafeToString(respData))
-		if len(body) > 0 {
-			redirectChain.WriteString(tostring.UnsafeToString(body))
+		if len(dumpBody) > 0 {
+			redirectChain.WriteString(tostring.UnsafeToString(dumpBody))
 		}
 		redirects = append(redirects, redirectChain.String())
 		redirectResp = redirectResp.Request.Response
@@ -63,6 +87,66 @@ func dumpResponseWithRedirectChain(resp *http.Response, body []byte) ([]byte, er
 	return redirectChain.Bytes(), nil
 }
 
+// dumpResponseWithRedirectChainStream is the streaming entry point for the
+// root response body - the main body dumpResponseWithRedirectChain's body
+// parameter assumes is already fully read, and the path the request that
+// introduced StreamingBody used as its own motivating multi-GB-response OOM
+// example. It peeks only the (still content-encoded, if any) bytes the
+// dump/trace path actually needs off bodyReader instead of buffering the
+// whole body up front, before handing off to dumpResponseWithRedirectChain
+// for the rest of the chain - which keeps the same raw-bytes-in contract
+// emitTraceEvent/handleDecompression already expect.
+func dumpResponseWithRedirectChainStream(resp *http.Response, bodyReader io.Reader) ([]byte, error) {
+	streamingBody := NewStreamingBody(bodyReader, 0)
+	body, err := streamingBody.PeekN(defaultStreamingBodyCap)
+	if err != nil {
+		return nil, err
+	}
+
+	// the chain writer places the root hop last in its output, so the
+	// truncation marker can simply be appended to the end of the final
+	// result afterwards without disturbing the bytes handed to the trace
+	// event/matchers above.
+	dump, err := dumpResponseWithRedirectChain(resp, body)
+	if err != nil {
+		return nil, err
+	}
+	if discarded, drainErr := streamingBody.Drain(); drainErr == nil && discarded > 0 {
+		dump = append(dump, []byte(fmt.Sprintf("\n[...truncated %d bytes]", discarded))...)
+	}
+	return dump, nil
+}
+
+// decodedStreamingBody wraps rawBody in handleDecompressionStream and
+// returns a StreamingBody over the lazily-decoded result, so matchers that
+// only need PeekN/ScanRegex/Hash pay only for the bytes they actually
+// consume instead of the executor eagerly decompressing (and buffering) the
+// whole body the way handleDecompression does.
+func decodedStreamingBody(resp *http.Response, rawBody io.Reader) (*StreamingBody, error) {
+	decoded, err := handleDecompressionStream(resp, rawBody)
+	if err != nil {
+		return nil, err
+	}
+	return NewStreamingBody(decoded, 0), nil
+}
+
+// dumpResponseViaDoer dumps resp through the same HTTPDoer that sent the
+// request producing it (recovered from the request's context via
+// WithClientName/WithFingerprint, attached by dump()), rather than always
+// falling back to a bare httputil.DumpResponse - so a doer backed by a
+// different transport gets a chance to render its own dump format.
+func dumpResponseViaDoer(resp *http.Response) ([]byte, error) {
+	var clientName string
+	if resp != nil && resp.Request != nil {
+		clientName = clientNameFromResponse(resp)
+	}
+	doer, err := doerByName(clientName, doerOptionsFromResponse(resp))
+	if err != nil {
+		return nil, err
+	}
+	return doer.DumpResponse(resp)
+}
+
 // headersToString converts http headers to string
 func headersToString(headers http.Header) string {
 	builder := &strings.Builder{}
@@ -85,38 +169,191 @@ func headersToString(headers http.Header) string {
 	return builder.String()
 }
 
-// dump creates a dump of the http request in form of a byte slice
-func dump(req *generatedRequest, reqURL string) ([]byte, error) {
+// dump creates a dump of the http request in form of a byte slice.
+//
+// clientName selects which registered HTTPDoer produces the dump (see
+// doer.go) - the template's `client:` field - defaulting to "stdlib" for
+// req.request and "rawhttp" for req.rawRequest when empty. If clientName is
+// empty and req.request carries a WithClientName selection from an earlier
+// WithClientName call (eg. attached by the executor while parsing the
+// template's `client:` field), that selection is used instead of the bare
+// stdlib/rawhttp default.
+func dump(req *generatedRequest, reqURL string, clientName string) ([]byte, error) {
+	if clientName == "" && req.request != nil {
+		clientName = clientNameFromRequest(req.request.Request)
+	}
+	if clientName == "" {
+		if req.request != nil {
+			clientName = "stdlib"
+		} else {
+			clientName = "rawhttp"
+		}
+	}
+
+	options := DoerOptions{}
 	if req.request != nil {
-		// Create a copy on the fly of the request body - ignore errors
-		bodyBytes, _ := req.request.BodyBytes()
-		req.request.Request.Body = ioutil.NopCloser(bytes.NewReader(bodyBytes))
-		return httputil.DumpRequestOut(req.request.Request, true)
+		options.Fingerprint = fingerprintFromRequest(req.request.Request)
 	}
-	return rawhttp.DumpRequestRaw(req.rawRequest.Method, reqURL, req.rawRequest.Path, generators.ExpandMapValues(req.rawRequest.Headers), ioutil.NopCloser(strings.NewReader(req.rawRequest.Data)), rawhttp.Options{CustomHeaders: req.rawRequest.UnsafeHeaders})
+	if req.rawRequest != nil {
+		options.UnsafeProtocol = req.rawRequest.UnsafeProtocol
+	}
+
+	doer, err := doerByName(clientName, options)
+	if err != nil {
+		return nil, err
+	}
+	if req.request != nil {
+		req.request.Request = WithClientName(req.request.Request, clientName)
+	}
+	return doer.DumpRequest(req, reqURL)
+}
+
+// defaultMaxDecompressionSize is the default cumulative size handleDecompression
+// will produce across all stacked content-encoding layers before it refuses to
+// keep decoding, to guard against decompression bombs.
+const defaultMaxDecompressionSize = 10 * 1024 * 1024 // 10MB
+
+// maxDecompressionSize is the cumulative decompressed size cap enforced by
+// handleDecompression. It's read from every in-flight scan goroutine that
+// decompresses a response, so it's only ever touched through the atomic
+// accessors below instead of as a plain package var.
+var maxDecompressionSize int64 = defaultMaxDecompressionSize
+
+// MaxDecompressionSize returns the cumulative decompressed size cap enforced
+// by handleDecompression.
+func MaxDecompressionSize() int64 {
+	return atomic.LoadInt64(&maxDecompressionSize)
+}
+
+// SetMaxDecompressionSize raises/lowers the cumulative decompressed size cap
+// enforced by handleDecompression (eg. from the executor's options struct).
+// Safe to call concurrently with in-flight decompression on other goroutines.
+func SetMaxDecompressionSize(size int64) {
+	atomic.StoreInt64(&maxDecompressionSize, size)
+}
+
+// ErrDecompressionBomb is returned when a response's decompressed size would
+// exceed MaxDecompressionSize.
+var ErrDecompressionBomb = errors.New("decompressed response exceeds the configured size limit")
+
+// DecompressionError wraps a decoding failure with the specific
+// content-encoding layer that caused it, so callers can log which layer of a
+// stacked encoding (eg. "gzip, br") broke.
+type DecompressionError struct {
+	Encoding string
+	Err      error
+}
+
+func (e *DecompressionError) Error() string {
+	return fmt.Sprintf("could not decode %q content-encoding layer: %s", e.Encoding, e.Err)
+}
+
+func (e *DecompressionError) Unwrap() error {
+	return e.Err
 }
 
 // handleDecompression if the user specified a custom encoding (as golang transport doesn't do this automatically)
+//
+// Content-Encoding may list several encodings applied in sequence (eg.
+// "gzip, br"), in which case they were applied in that order by the server
+// and must be undone in reverse.
 func handleDecompression(resp *http.Response, bodyOrig []byte) (bodyDec []byte, err error) {
 	if resp == nil {
 		return bodyOrig, nil
 	}
+	// a doer other than stdlib (eg. fasthttp) may have already decompressed
+	// the body itself before handing the response back.
+	if alreadyDecodedByDoer(resp) {
+		return bodyOrig, nil
+	}
 
 	encodingHeader := strings.TrimSpace(strings.ToLower(resp.Header.Get("Content-Encoding")))
-	if strings.Contains(encodingHeader, "gzip") {
-		gzipreader, err := gzip.NewReader(bytes.NewReader(bodyOrig))
+	if encodingHeader == "" {
+		return bodyOrig, nil
+	}
+
+	encodings := strings.Split(encodingHeader, ",")
+	body := bodyOrig
+	// remaining is the cumulative decompressed-size budget shared across every
+	// stacked layer below, not reset per layer - otherwise a N-layer stack
+	// (eg. "gzip, br") could each decompress up to the full cap independently,
+	// producing up to Nx the configured limit overall.
+	remaining := MaxDecompressionSize()
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := strings.TrimSpace(encodings[i])
+		if encoding == "" {
+			continue
+		}
+		if remaining <= 0 {
+			return bodyOrig, &DecompressionError{Encoding: encoding, Err: ErrDecompressionBomb}
+		}
+		body, err = decodeContentEncodingLayer(encoding, body, remaining)
 		if err != nil {
-			return bodyOrig, err
+			return bodyOrig, &DecompressionError{Encoding: encoding, Err: err}
 		}
-		defer gzipreader.Close()
+		remaining -= int64(len(body))
+	}
+	return body, nil
+}
 
-		bodyDec, err = ioutil.ReadAll(gzipreader)
+// decodeContentEncodingLayer decodes a single Content-Encoding layer, capping
+// its output at budget bytes (the cumulative allowance still left across the
+// whole stack). Unknown encodings are passed through unchanged, matching the
+// previous behavior of only recognizing gzip and leaving anything else
+// untouched.
+func decodeContentEncodingLayer(encoding string, body []byte, budget int64) ([]byte, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		gzipReader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+		return readCappedDecompressed(gzipReader, budget)
+	case "deflate":
+		return decodeDeflate(body, budget)
+	case "br":
+		return readCappedDecompressed(brotli.NewReader(bytes.NewReader(body)), budget)
+	case "zstd":
+		zstdReader, err := zstd.NewReader(bytes.NewReader(body))
 		if err != nil {
-			return bodyOrig, err
+			return nil, err
 		}
-		return bodyDec, nil
+		defer zstdReader.Close()
+		return readCappedDecompressed(zstdReader, budget)
+	default:
+		return body, nil
+	}
+}
+
+// decodeDeflate decodes a "deflate" Content-Encoding layer. Per RFC 2616 this
+// is a zlib stream, but a number of servers emit raw DEFLATE without the
+// zlib header, so fall back to compress/flate when the zlib header is absent
+// or invalid. budget is the cumulative decompressed-size allowance still left
+// across the whole Content-Encoding stack.
+func decodeDeflate(body []byte, budget int64) ([]byte, error) {
+	if zlibReader, zlibErr := zlib.NewReader(bytes.NewReader(body)); zlibErr == nil {
+		defer zlibReader.Close()
+		return readCappedDecompressed(zlibReader, budget)
+	}
+	flateReader := flate.NewReader(bytes.NewReader(body))
+	defer flateReader.Close()
+	return readCappedDecompressed(flateReader, budget)
+}
+
+// readCappedDecompressed reads r fully while enforcing budget - the
+// cumulative decompressed-size allowance still left across the whole
+// Content-Encoding stack, not a fresh per-layer limit - returning
+// ErrDecompressionBomb if it's exceeded.
+func readCappedDecompressed(r io.Reader, budget int64) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, budget+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > budget {
+		return nil, ErrDecompressionBomb
 	}
-	return bodyOrig, nil
+	return data, nil
 }
 
 // rawHasBody checks if a RFC compliant request has the body
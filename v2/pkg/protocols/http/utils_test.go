@@ -0,0 +1,154 @@
+package http
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"net/http"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipBytes(t *testing.T, data string) []byte {
+	buf := &bytes.Buffer{}
+	writer := gzip.NewWriter(buf)
+	_, err := writer.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func brotliBytes(t *testing.T, data string) []byte {
+	buf := &bytes.Buffer{}
+	writer := brotli.NewWriter(buf)
+	_, err := writer.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func zstdBytes(t *testing.T, data string) []byte {
+	buf := &bytes.Buffer{}
+	writer, err := zstd.NewWriter(buf)
+	require.NoError(t, err)
+	_, err = writer.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func rawDeflateBytes(t *testing.T, data string) []byte {
+	buf := &bytes.Buffer{}
+	writer, err := flate.NewWriter(buf, flate.DefaultCompression)
+	require.NoError(t, err)
+	_, err = writer.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func TestHandleDecompressionSingleEncodings(t *testing.T) {
+	const want = "hello nuclei"
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+	}{
+		{"gzip", "gzip", gzipBytes(t, want)},
+		{"brotli", "br", brotliBytes(t, want)},
+		{"zstd", "zstd", zstdBytes(t, want)},
+		{"raw deflate", "deflate", rawDeflateBytes(t, want)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{"Content-Encoding": []string{tt.encoding}}}
+			got, err := handleDecompression(resp, tt.body)
+			require.NoError(t, err)
+			require.Equal(t, want, string(got))
+		})
+	}
+}
+
+func TestHandleDecompressionStackedEncodings(t *testing.T) {
+	const want = "stacked encodings body"
+
+	// the server applied gzip first and then br, so Content-Encoding reads
+	// "gzip, br" and must be unwrapped br -> gzip.
+	stacked := brotliBytes(t, string(gzipBytes(t, want)))
+
+	resp := &http.Response{Header: http.Header{"Content-Encoding": []string{"gzip, br"}}}
+	got, err := handleDecompression(resp, stacked)
+	require.NoError(t, err)
+	require.Equal(t, want, string(got))
+}
+
+func TestHandleDecompressionMalformed(t *testing.T) {
+	resp := &http.Response{Header: http.Header{"Content-Encoding": []string{"gzip"}}}
+	body := []byte("not actually gzip data")
+
+	got, err := handleDecompression(resp, body)
+	require.Error(t, err)
+	require.Equal(t, body, got)
+
+	var decompressionErr *DecompressionError
+	require.ErrorAs(t, err, &decompressionErr)
+	require.Equal(t, "gzip", decompressionErr.Encoding)
+}
+
+func TestHandleDecompressionNoEncoding(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+	body := []byte("plain body")
+
+	got, err := handleDecompression(resp, body)
+	require.NoError(t, err)
+	require.Equal(t, body, got)
+}
+
+func TestHandleDecompressionBombCap(t *testing.T) {
+	previous := MaxDecompressionSize()
+	SetMaxDecompressionSize(8)
+	defer SetMaxDecompressionSize(previous)
+
+	resp := &http.Response{Header: http.Header{"Content-Encoding": []string{"gzip"}}}
+	got, err := handleDecompression(resp, gzipBytes(t, "this body is longer than eight bytes"))
+	require.ErrorIs(t, err, ErrDecompressionBomb)
+	require.NotEqual(t, "this body is longer than eight bytes", string(got))
+}
+
+func TestHandleDecompressionBombCapIsCumulativeAcrossLayers(t *testing.T) {
+	const want = "this body is longer than the cap once either layer is undone"
+
+	// each layer's own decompressed output is under the 100 byte cap set
+	// below, but together (br undone, then gzip undone) they exceed it - the cap must
+	// apply across the whole stack, not reset fresh for each layer.
+	stacked := brotliBytes(t, string(gzipBytes(t, want)))
+
+	previous := MaxDecompressionSize()
+	// large enough that undoing either single layer on its own stays under
+	// the cap, but their combined output does not - a per-layer-reset budget
+	// would wrongly let this through.
+	SetMaxDecompressionSize(100)
+	defer SetMaxDecompressionSize(previous)
+
+	resp := &http.Response{Header: http.Header{"Content-Encoding": []string{"gzip, br"}}}
+	got, err := handleDecompression(resp, stacked)
+	require.ErrorIs(t, err, ErrDecompressionBomb)
+	require.Equal(t, stacked, got)
+}
+
+func TestHeadersToString(t *testing.T) {
+	headers := http.Header{"X-Test": []string{"one", "two"}}
+	got := headersToString(headers)
+	require.Contains(t, got, "X-Test: one")
+	require.Contains(t, got, "X-Test: two")
+}
+
+func TestRawHasBody(t *testing.T) {
+	require.False(t, rawHasBody("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	require.True(t, rawHasBody("POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 4\r\n\r\nabcd"))
+}